@@ -0,0 +1,68 @@
+// Package fetch provides pluggable backends for retrieving a URL's content
+// and converting it to Markdown, so the page processor can trade off cost,
+// speed, and rendering fidelity per domain or per message.
+package fetch
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/observability"
+)
+
+// Backend names accepted in InputMessage.Renderer and renderer override
+// configuration.
+const (
+	BackendStatic    = "static"
+	BackendHeadless  = "headless"
+	BackendFirecrawl = "firecrawl"
+)
+
+// Fetcher retrieves the raw content at url.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (contentType string, body []byte, err error)
+}
+
+// Converter turns fetched content into Markdown.
+type Converter interface {
+	Convert(ctx context.Context, contentType string, body []byte) (string, error)
+}
+
+// Pipeline pairs a Fetcher and a Converter so callers can run a backend by
+// name without knowing how fetching and conversion are implemented.
+type Pipeline struct {
+	Fetcher   Fetcher
+	Converter Converter
+}
+
+// Run fetches rawURL and converts the result to Markdown, recording
+// per-host fetch latency and conversion time/output size as it goes.
+func (p Pipeline) Run(ctx context.Context, rawURL string) (string, error) {
+	fetchStart := time.Now()
+	contentType, body, err := p.Fetcher.Fetch(ctx, rawURL)
+	observability.FetchDuration.WithLabelValues(hostOf(rawURL)).Observe(time.Since(fetchStart).Seconds())
+	if err != nil {
+		return "", err
+	}
+
+	convertStart := time.Now()
+	markdown, err := p.Converter.Convert(ctx, contentType, body)
+	observability.ConversionDuration.Observe(time.Since(convertStart).Seconds())
+	if err != nil {
+		return "", err
+	}
+	observability.MarkdownOutputBytes.Observe(float64(len(markdown)))
+
+	return markdown, nil
+}
+
+// hostOf returns rawURL's host for metric labeling, or "unknown" if it
+// doesn't parse.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
@@ -0,0 +1,89 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/observability"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/retry"
+)
+
+const firecrawlScrapeAPIURL = "https://api.firecrawl.dev/v1/scrape"
+
+// FirecrawlFetcher delegates fetching and HTML-to-Markdown conversion to
+// Firecrawl's hosted /scrape endpoint, trading cost for Firecrawl's own
+// rendering and extraction quality.
+type FirecrawlFetcher struct {
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewFirecrawlFetcher returns a FirecrawlFetcher authenticated with apiKey.
+func NewFirecrawlFetcher(apiKey string) *FirecrawlFetcher {
+	return &FirecrawlFetcher{APIKey: apiKey, HTTPClient: &http.Client{}}
+}
+
+type firecrawlScrapeRequest struct {
+	URL     string   `json:"url"`
+	Formats []string `json:"formats"`
+}
+
+type firecrawlScrapeResponse struct {
+	Data struct {
+		Markdown string `json:"markdown"`
+	} `json:"data"`
+}
+
+// Fetch calls Firecrawl's /scrape endpoint and returns the Markdown it
+// produces, tagged as "text/markdown" so PassthroughConverter can hand it
+// back unchanged.
+func (f *FirecrawlFetcher) Fetch(ctx context.Context, url string) (string, []byte, error) {
+	reqBody, err := json.Marshal(firecrawlScrapeRequest{URL: url, Formats: []string{"markdown"}})
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch: failed to build firecrawl scrape request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, firecrawlScrapeAPIURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch: failed to create firecrawl scrape request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+f.APIKey)
+
+	start := time.Now()
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		observability.FirecrawlRequestDuration.WithLabelValues("scrape", "error").Observe(time.Since(start).Seconds())
+		return "", nil, fmt.Errorf("fetch: firecrawl scrape request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	observability.FirecrawlRequestDuration.WithLabelValues("scrape", strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("fetch: firecrawl scrape failed with status %d: %s", resp.StatusCode, string(body))
+		return "", nil, retry.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)
+	}
+
+	var scrapeResp firecrawlScrapeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&scrapeResp); err != nil {
+		return "", nil, fmt.Errorf("fetch: failed to decode firecrawl scrape response: %w", err)
+	}
+
+	return "text/markdown", []byte(scrapeResp.Data.Markdown), nil
+}
+
+// PassthroughConverter returns already-converted content (e.g. Markdown
+// produced upstream by Firecrawl) unchanged.
+type PassthroughConverter struct{}
+
+// Convert implements Converter.
+func (PassthroughConverter) Convert(ctx context.Context, contentType string, body []byte) (string, error) {
+	return string(body), nil
+}
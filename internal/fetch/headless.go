@@ -0,0 +1,45 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// HeadlessFetcher renders url in a headless Chrome instance via chromedp,
+// waiting for the page to settle before extracting the DOM. Use this
+// backend for JavaScript-heavy pages the static fetcher can't see past.
+type HeadlessFetcher struct {
+	// NetworkIdleWait is how long to wait after navigation for in-flight
+	// XHR/fetch activity to settle before reading the DOM.
+	NetworkIdleWait time.Duration
+}
+
+// NewHeadlessFetcher returns a HeadlessFetcher with a sensible default
+// network-idle wait.
+func NewHeadlessFetcher() *HeadlessFetcher {
+	return &HeadlessFetcher{NetworkIdleWait: 2 * time.Second}
+}
+
+// Fetch implements Fetcher.
+func (f *HeadlessFetcher) Fetch(ctx context.Context, url string) (string, []byte, error) {
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, chromedp.DefaultExecAllocatorOptions[:]...)
+	defer cancelAlloc()
+
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+
+	var html string
+	err := chromedp.Run(browserCtx,
+		chromedp.Navigate(url),
+		chromedp.Sleep(f.NetworkIdleWait),
+		chromedp.OuterHTML("html", &html),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch: headless render failed for %s: %w", url, err)
+	}
+
+	return "text/html", []byte(html), nil
+}
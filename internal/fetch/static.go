@@ -0,0 +1,77 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	md "github.com/JohannesKaufmann/html-to-markdown/v2"
+	fakeUserAgent "github.com/lib4u/fake-useragent"
+
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/retry"
+)
+
+// StaticFetcher downloads a URL with a single plain HTTP GET. It's the
+// cheapest backend but won't see content rendered by client-side
+// JavaScript.
+type StaticFetcher struct {
+	HTTPClient *http.Client
+}
+
+// NewStaticFetcher returns a StaticFetcher using a default http.Client.
+func NewStaticFetcher() *StaticFetcher {
+	return &StaticFetcher{HTTPClient: &http.Client{}}
+}
+
+// Fetch implements Fetcher.
+func (f *StaticFetcher) Fetch(ctx context.Context, url string) (string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch: failed to create request: %w", err)
+	}
+
+	// Using a fake user-agent to avoid being blocked by some websites.
+	ua, err := fakeUserAgent.New()
+	if err != nil {
+		// Fallback to a generic user-agent if the library fails
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36")
+	} else {
+		req.Header.Set("User-Agent", ua.GetRandom())
+	}
+
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch: failed to download URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("fetch: failed to download URL: status code %d", resp.StatusCode)
+		return "", nil, retry.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch: failed to read response body: %w", err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/html"
+	}
+
+	return contentType, body, nil
+}
+
+// HTMLConverter converts HTML bodies to Markdown using html-to-markdown.
+type HTMLConverter struct{}
+
+// Convert implements Converter.
+func (HTMLConverter) Convert(ctx context.Context, contentType string, body []byte) (string, error) {
+	markdown, err := md.ConvertString(string(body))
+	if err != nil {
+		return "", fmt.Errorf("fetch: failed to convert HTML to Markdown: %w", err)
+	}
+	return markdown, nil
+}
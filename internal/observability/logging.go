@@ -0,0 +1,15 @@
+package observability
+
+import "go.uber.org/zap"
+
+// NewLogger returns a JSON structured logger tagged with service, so
+// log-based tracing across the URL mapper and page processor works by
+// filtering on a shared field (typically uid or domain) across both
+// services' output.
+func NewLogger(service string) *zap.SugaredLogger {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	return logger.Sugar().With("service", service)
+}
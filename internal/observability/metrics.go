@@ -0,0 +1,72 @@
+package observability
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Message-lifecycle counters, labeled by the service that moved the
+// message through that state ("url_mapper" or "page_processor").
+var (
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_messages_received_total",
+		Help: "Pub/Sub push messages received, before processing.",
+	}, []string{"service"})
+
+	MessagesAcked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_messages_acked_total",
+		Help: "Pub/Sub push messages acknowledged after successful processing.",
+	}, []string{"service"})
+
+	MessagesNacked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_messages_nacked_total",
+		Help: "Pub/Sub push messages returned as an error for Pub/Sub to redeliver.",
+	}, []string{"service"})
+
+	MessagesDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_messages_dead_lettered_total",
+		Help: "Messages republished to the dead letter topic after exhausting retries.",
+	}, []string{"service"})
+)
+
+// Firecrawl, fetch, conversion, and publish timing.
+var (
+	FirecrawlRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crawler_firecrawl_request_duration_seconds",
+		Help:    "Latency of calls to the Firecrawl API.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "status"})
+
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crawler_fetch_duration_seconds",
+		Help:    "Latency of fetching a page's raw content, per host.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"host"})
+
+	ConversionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "crawler_conversion_duration_seconds",
+		Help:    "Time spent converting fetched content to Markdown.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	MarkdownOutputBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "crawler_markdown_output_bytes",
+		Help:    "Size in bytes of the Markdown produced per page.",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+	})
+
+	PublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crawler_publish_duration_seconds",
+		Help:    "Latency of a Pub/Sub publish, from Publish() to the PublishResult resolving.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+)
+
+// Handler serves the Prometheus text exposition format for the metrics
+// registered above. Both services mount this at /metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,41 @@
+package observability
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Tracer spans the URL mapper -> page processor pipeline. With no
+// TracerProvider registered, it produces no-op spans whose context still
+// propagates correctly, so InjectTraceparent/ExtractTraceparent keep
+// working even before an exporter is wired up.
+var Tracer = otel.Tracer("github.com/vantige-ai/naive-crawler-datamesh")
+
+var propagator = propagation.TraceContext{}
+
+// InjectTraceparent encodes the span in ctx as a W3C traceparent (plus
+// tracestate, if any) into attrs, so it can ride along on a Pub/Sub
+// message's Attributes to the next service in the pipeline. attrs may be
+// nil.
+func InjectTraceparent(ctx context.Context, attrs map[string]string) map[string]string {
+	if attrs == nil {
+		attrs = make(map[string]string, 2)
+	}
+	propagator.Inject(ctx, propagation.MapCarrier(attrs))
+	return attrs
+}
+
+// ExtractTraceparent returns a context carrying the remote span described
+// by attrs' "traceparent"/"tracestate", so the receiving service can start
+// a child span that continues the same trace.
+func ExtractTraceparent(ctx context.Context, attrs map[string]string) context.Context {
+	carrier := propagation.MapCarrier{}
+	for _, k := range []string{"traceparent", "tracestate"} {
+		if v, ok := attrs[k]; ok {
+			carrier[k] = v
+		}
+	}
+	return propagator.Extract(ctx, carrier)
+}
@@ -0,0 +1,69 @@
+package politeness
+
+import (
+	"sync"
+	"time"
+)
+
+// HostLimiter enforces a minimum interval between requests to the same
+// host, implemented as a per-host token bucket with a capacity of one.
+type HostLimiter struct {
+	mu              sync.Mutex
+	defaultInterval time.Duration
+	buckets         map[string]*hostBucket
+}
+
+type hostBucket struct {
+	interval time.Duration
+	nextSlot time.Time
+}
+
+// NewHostLimiter returns a HostLimiter that allows one request per
+// defaultInterval to any host, until overridden per-host via SetInterval.
+func NewHostLimiter(defaultInterval time.Duration) *HostLimiter {
+	return &HostLimiter{
+		defaultInterval: defaultInterval,
+		buckets:         make(map[string]*hostBucket),
+	}
+}
+
+// SetInterval overrides the crawl interval for a specific host, typically
+// sourced from that host's robots.txt Crawl-delay directive.
+func (l *HostLimiter) SetInterval(host string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bucketFor(host).interval = interval
+}
+
+// Reserve reports whether a request to host may proceed immediately. If
+// not, it returns the duration the caller should wait before the bucket
+// refills. Callers that can't block inline (e.g. a Pub/Sub push handler
+// close to its ack deadline) should use retryAfter to requeue the message
+// instead of sleeping it out.
+func (l *HostLimiter) Reserve(host string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucketFor(host)
+	now := time.Now()
+	if now.Before(b.nextSlot) {
+		return false, b.nextSlot.Sub(now)
+	}
+
+	b.nextSlot = now.Add(b.interval)
+	return true, 0
+}
+
+func (l *HostLimiter) bucketFor(host string) *hostBucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &hostBucket{interval: l.defaultInterval}
+		l.buckets[host] = b
+	}
+	return b
+}
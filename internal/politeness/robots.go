@@ -0,0 +1,219 @@
+// Package politeness provides shared robots.txt compliance and per-host
+// rate limiting for the URL mapper and page processor services.
+package politeness
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRobotsTimeout = 10 * time.Second
+
+// robotsRules holds the directives parsed out of a host's robots.txt that
+// apply to our user-agent.
+type robotsRules struct {
+	disallow   []string
+	allow      []string
+	crawlDelay time.Duration
+	sitemaps   []string
+	fetchedAt  time.Time
+}
+
+// RobotsChecker fetches and caches robots.txt per host and answers whether a
+// given URL may be crawled.
+type RobotsChecker struct {
+	userAgent  string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*robotsRules
+}
+
+// NewRobotsChecker returns a RobotsChecker that caches parsed robots.txt
+// files for ttl before refetching them.
+func NewRobotsChecker(userAgent string, ttl time.Duration) *RobotsChecker {
+	return &RobotsChecker{
+		userAgent:  userAgent,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: defaultRobotsTimeout},
+		cache:      make(map[string]*robotsRules),
+	}
+}
+
+// Allowed reports whether rawURL may be fetched according to its host's
+// robots.txt. A malformed URL is an error; a missing or unreachable
+// robots.txt is treated as allowing everything, since the absence of rules
+// imposes no restriction.
+func (c *RobotsChecker) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("politeness: failed to parse URL %q: %w", rawURL, err)
+	}
+
+	rules, err := c.rulesFor(ctx, u)
+	if err != nil {
+		return true, nil
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return matchAllowed(rules, path), nil
+}
+
+// CrawlDelay returns the Crawl-delay directive advertised by rawURL's host,
+// if any.
+func (c *RobotsChecker) CrawlDelay(ctx context.Context, rawURL string) (time.Duration, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, false
+	}
+
+	rules, err := c.rulesFor(ctx, u)
+	if err != nil || rules.crawlDelay == 0 {
+		return 0, false
+	}
+
+	return rules.crawlDelay, true
+}
+
+// Sitemaps returns the Sitemap: entries advertised in rawURL's host's
+// robots.txt.
+func (c *RobotsChecker) Sitemaps(ctx context.Context, rawURL string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("politeness: failed to parse URL %q: %w", rawURL, err)
+	}
+
+	rules, err := c.rulesFor(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules.sitemaps, nil
+}
+
+func (c *RobotsChecker) rulesFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	host := u.Hostname()
+
+	c.mu.Lock()
+	rules, ok := c.cache[host]
+	c.mu.Unlock()
+	if ok && time.Since(rules.fetchedAt) < c.ttl {
+		return rules, nil
+	}
+
+	rules, err := c.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[host] = rules
+	c.mu.Unlock()
+
+	return rules, nil
+}
+
+func (c *RobotsChecker) fetch(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	robotsURL := fmt.Sprintf("%s://%s/robots.txt", u.Scheme, u.Host)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("politeness: failed to build robots.txt request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("politeness: failed to fetch robots.txt for %s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	rules := &robotsRules{fetchedAt: time.Now()}
+
+	// A missing or erroring robots.txt means no restrictions apply. Cache
+	// the empty rule set anyway so we don't hammer the host with repeated
+	// 404s for the lifetime of the TTL.
+	if resp.StatusCode != http.StatusOK {
+		return rules, nil
+	}
+
+	parseRobotsTxt(resp.Body, c.userAgent, rules)
+	return rules, nil
+}
+
+func parseRobotsTxt(body io.Reader, userAgent string, rules *robotsRules) {
+	scanner := bufio.NewScanner(body)
+	applies := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			agent := strings.ToLower(value)
+			applies = agent == "*" || strings.Contains(strings.ToLower(userAgent), agent)
+		case "sitemap":
+			// Sitemap directives aren't scoped to a user-agent block.
+			rules.sitemaps = append(rules.sitemaps, value)
+		case "disallow":
+			if applies && value != "" {
+				rules.disallow = append(rules.disallow, value)
+			}
+		case "allow":
+			if applies && value != "" {
+				rules.allow = append(rules.allow, value)
+			}
+		case "crawl-delay":
+			if applies {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil {
+					rules.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+}
+
+// matchAllowed applies the longest-match-wins rule most robots.txt parsers
+// use: whichever Allow/Disallow pattern is the longest prefix match of path
+// governs.
+func matchAllowed(rules *robotsRules, path string) bool {
+	bestLen := -1
+	allowed := true
+
+	check := func(patterns []string, allow bool) {
+		for _, p := range patterns {
+			if p != "" && strings.HasPrefix(path, p) && len(p) > bestLen {
+				bestLen = len(p)
+				allowed = allow
+			}
+		}
+	}
+
+	check(rules.disallow, false)
+	check(rules.allow, true)
+
+	return allowed
+}
@@ -0,0 +1,223 @@
+package politeness
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchAllowedLongestPrefixWins(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules *robotsRules
+		path  string
+		want  bool
+	}{
+		{"no rules allows everything", &robotsRules{}, "/private/secret", true},
+		{"disallow prefix blocks", &robotsRules{disallow: []string{"/private"}}, "/private/secret", false},
+		{"unrelated disallow doesn't block", &robotsRules{disallow: []string{"/private"}}, "/public", true},
+		{
+			"longer allow overrides shorter disallow",
+			&robotsRules{disallow: []string{"/private"}, allow: []string{"/private/public"}},
+			"/private/public/page",
+			true,
+		},
+		{
+			"longer disallow overrides shorter allow",
+			&robotsRules{disallow: []string{"/private/secret"}, allow: []string{"/private"}},
+			"/private/secret/page",
+			false,
+		},
+		{
+			"equal-length disallow and allow: disallow checked after allow wins by order",
+			&robotsRules{disallow: []string{"/a"}, allow: []string{"/a"}},
+			"/a",
+			false,
+		},
+		{"empty pattern never matches", &robotsRules{disallow: []string{""}}, "/anything", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchAllowed(tt.rules, tt.path); got != tt.want {
+				t.Errorf("matchAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRobotsTxtUserAgentScoping(t *testing.T) {
+	body := `
+User-agent: othercrawler
+Disallow: /only-other
+
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2.5
+Sitemap: https://example.com/sitemap.xml
+`
+	rules := &robotsRules{}
+	parseRobotsTxt(strings.NewReader(body), "naive-crawler", rules)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/private" {
+		t.Errorf("disallow = %v, want [/private] (rules scoped to other user-agents must not apply)", rules.disallow)
+	}
+	if len(rules.allow) != 1 || rules.allow[0] != "/private/public" {
+		t.Errorf("allow = %v, want [/private/public]", rules.allow)
+	}
+	if rules.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("crawlDelay = %v, want 2.5s", rules.crawlDelay)
+	}
+	if len(rules.sitemaps) != 1 || rules.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("sitemaps = %v, want [https://example.com/sitemap.xml]", rules.sitemaps)
+	}
+}
+
+func TestParseRobotsTxtMatchesUserAgentByPrefix(t *testing.T) {
+	body := `
+User-agent: naive
+Disallow: /blocked
+`
+	rules := &robotsRules{}
+	parseRobotsTxt(strings.NewReader(body), "naive-crawler/1.0", rules)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/blocked" {
+		t.Errorf("disallow = %v, want [/blocked]", rules.disallow)
+	}
+}
+
+func TestParseRobotsTxtSitemapNotScopedToUserAgent(t *testing.T) {
+	body := `
+User-agent: othercrawler
+Disallow: /whatever
+Sitemap: https://example.com/sitemap.xml
+`
+	rules := &robotsRules{}
+	parseRobotsTxt(strings.NewReader(body), "naive-crawler", rules)
+
+	if len(rules.sitemaps) != 1 || rules.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("sitemaps = %v, want [https://example.com/sitemap.xml] (Sitemap applies regardless of user-agent block)", rules.sitemaps)
+	}
+}
+
+func TestParseRobotsTxtEmptyBodyAllowsEverything(t *testing.T) {
+	rules := &robotsRules{}
+	parseRobotsTxt(strings.NewReader(""), "naive-crawler", rules)
+
+	if len(rules.disallow) != 0 || len(rules.allow) != 0 || len(rules.sitemaps) != 0 {
+		t.Errorf("rules = %+v, want all empty", rules)
+	}
+	if !matchAllowed(rules, "/anything") {
+		t.Error("matchAllowed() = false, want true for an empty robots.txt")
+	}
+}
+
+func TestParseRobotsTxtIgnoresCommentsAndBlankLines(t *testing.T) {
+	body := `
+# a comment
+User-agent: *
+
+# another comment
+Disallow: /blocked
+`
+	rules := &robotsRules{}
+	parseRobotsTxt(strings.NewReader(body), "naive-crawler", rules)
+
+	if len(rules.disallow) != 1 || rules.disallow[0] != "/blocked" {
+		t.Errorf("disallow = %v, want [/blocked]", rules.disallow)
+	}
+}
+
+func newTestRobotsServer(t *testing.T, body string, status int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRobotsCheckerAllowedRespectsDisallow(t *testing.T) {
+	srv := newTestRobotsServer(t, "User-agent: *\nDisallow: /private\n", http.StatusOK)
+
+	c := NewRobotsChecker("naive-crawler", time.Minute)
+	allowed, err := c.Allowed(context.Background(), srv.URL+"/private/page")
+	if err != nil {
+		t.Fatalf("Allowed() error = %v", err)
+	}
+	if allowed {
+		t.Error("Allowed() = true, want false")
+	}
+
+	allowed, err = c.Allowed(context.Background(), srv.URL+"/public")
+	if err != nil {
+		t.Fatalf("Allowed() error = %v", err)
+	}
+	if !allowed {
+		t.Error("Allowed() = false, want true")
+	}
+}
+
+func TestRobotsCheckerAllowedTreatsMissingRobotsTxtAsAllowAll(t *testing.T) {
+	srv := newTestRobotsServer(t, "not found", http.StatusNotFound)
+
+	c := NewRobotsChecker("naive-crawler", time.Minute)
+	allowed, err := c.Allowed(context.Background(), srv.URL+"/anything")
+	if err != nil {
+		t.Fatalf("Allowed() error = %v", err)
+	}
+	if !allowed {
+		t.Error("Allowed() = false, want true for a missing robots.txt")
+	}
+}
+
+func TestRobotsCheckerAllowedRejectsMalformedURL(t *testing.T) {
+	c := NewRobotsChecker("naive-crawler", time.Minute)
+	if _, err := c.Allowed(context.Background(), "://not-a-url"); err == nil {
+		t.Error("Allowed() error = nil, want error for malformed URL")
+	}
+}
+
+func TestRobotsCheckerSitemaps(t *testing.T) {
+	srv := newTestRobotsServer(t, "User-agent: *\nSitemap: https://example.com/sitemap.xml\n", http.StatusOK)
+
+	c := NewRobotsChecker("naive-crawler", time.Minute)
+	sitemaps, err := c.Sitemaps(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Sitemaps() error = %v", err)
+	}
+	if len(sitemaps) != 1 || sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("Sitemaps() = %v, want [https://example.com/sitemap.xml]", sitemaps)
+	}
+}
+
+func TestRobotsCheckerSitemapsRejectsSchemelessURL(t *testing.T) {
+	c := NewRobotsChecker("naive-crawler", time.Minute)
+	if _, err := c.Sitemaps(context.Background(), "example.com"); err == nil {
+		t.Error("Sitemaps() error = nil, want error: a bare host with no scheme can't build a robots.txt request")
+	}
+}
+
+func TestRobotsCheckerCachesWithinTTL(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewRobotsChecker("naive-crawler", time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Allowed(context.Background(), srv.URL+"/page"); err != nil {
+			t.Fatalf("Allowed() error = %v", err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1 (should be cached within TTL)", hits)
+	}
+}
@@ -0,0 +1,86 @@
+package politeness
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type urlSet struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+type sitemapIndex struct {
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// FetchSitemapURLs downloads sitemapURL and returns the page URLs it lists.
+// If sitemapURL turns out to be a sitemap index, each child sitemap is
+// fetched in turn; only one level of index nesting is followed.
+func FetchSitemapURLs(ctx context.Context, client *http.Client, sitemapURL string) ([]string, error) {
+	return fetchSitemapURLs(ctx, client, sitemapURL, true)
+}
+
+func fetchSitemapURLs(ctx context.Context, client *http.Client, sitemapURL string, followIndex bool) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("politeness: failed to build sitemap request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("politeness: failed to fetch sitemap %s: %w", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("politeness: sitemap %s returned status %d", sitemapURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("politeness: failed to read sitemap %s: %w", sitemapURL, err)
+	}
+
+	var set urlSet
+	if err := xml.Unmarshal(body, &set); err == nil && len(set.URLs) > 0 {
+		urls := make([]string, 0, len(set.URLs))
+		for _, u := range set.URLs {
+			if u.Loc != "" {
+				urls = append(urls, u.Loc)
+			}
+		}
+		return urls, nil
+	}
+
+	if !followIndex {
+		return nil, nil
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("politeness: failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	var urls []string
+	for _, s := range index.Sitemaps {
+		if s.Loc == "" {
+			continue
+		}
+		childURLs, err := fetchSitemapURLs(ctx, client, s.Loc, false)
+		if err != nil {
+			// Skip sitemaps we can't fetch rather than failing discovery
+			// for the whole domain.
+			continue
+		}
+		urls = append(urls, childURLs...)
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,6 @@
+package politeness
+
+// DefaultUserAgent is sent on robots.txt and sitemap fetches, and used as
+// the default for page fetches, when a service hasn't been configured with
+// its own CRAWLER_USER_AGENT.
+const DefaultUserAgent = "NaiveCrawlerDatamesh/1.0 (+https://github.com/vantige-ai/naive-crawler-datamesh)"
@@ -0,0 +1,109 @@
+// Package pubsubutil provides shared helpers for configuring Pub/Sub
+// topics for high-throughput publishing and draining large batches of
+// publish results without spawning one goroutine per message.
+package pubsubutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/observability"
+)
+
+// defaultDrainWorkers bounds the goroutine pool Drain uses when the caller
+// doesn't override it via PUBLISH_DRAIN_WORKERS.
+const defaultDrainWorkers = 32
+
+// ConfigureFromEnv applies topic.PublishSettings overrides from
+// PUBLISH_COUNT_THRESHOLD, PUBLISH_BYTE_THRESHOLD,
+// PUBLISH_DELAY_THRESHOLD_MS, and PUBLISH_NUM_GOROUTINES, leaving the
+// client library's defaults in place for anything unset.
+func ConfigureFromEnv(topic *pubsub.Topic) {
+	if v := os.Getenv("PUBLISH_COUNT_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			topic.PublishSettings.CountThreshold = n
+		}
+	}
+	if v := os.Getenv("PUBLISH_BYTE_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			topic.PublishSettings.ByteThreshold = n
+		}
+	}
+	if v := os.Getenv("PUBLISH_DELAY_THRESHOLD_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			topic.PublishSettings.DelayThreshold = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if v := os.Getenv("PUBLISH_NUM_GOROUTINES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			topic.PublishSettings.NumGoroutines = n
+		}
+	}
+}
+
+// DrainWorkers returns the worker pool size Drain should use, from
+// PUBLISH_DRAIN_WORKERS or defaultDrainWorkers.
+func DrainWorkers() int {
+	if v := os.Getenv("PUBLISH_DRAIN_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultDrainWorkers
+}
+
+// Drain waits on results with a bounded pool of workers, rather than one
+// goroutine per result, recording crawler_publish_duration_seconds under
+// topicName for each, and returns an error describing how many (if any) of
+// the underlying publishes failed.
+func Drain(ctx context.Context, results []*pubsub.PublishResult, workers int, topicName string) error {
+	if workers <= 0 || workers > len(results) {
+		workers = len(results)
+	}
+	if workers == 0 {
+		return nil
+	}
+
+	work := make(chan *pubsub.PublishResult)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var failed int
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for res := range work {
+				start := time.Now()
+				_, err := res.Get(ctx)
+				observability.PublishDuration.WithLabelValues(topicName).Observe(time.Since(start).Seconds())
+				if err != nil {
+					mu.Lock()
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, res := range results {
+		work <- res
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return fmt.Errorf("pubsubutil: %d of %d publishes failed, first error: %w", failed, len(results), firstErr)
+	}
+	return nil
+}
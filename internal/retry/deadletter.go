@@ -0,0 +1,37 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// AttemptFromAttributes reads the x-attempt attribute DeadLetter sets on a
+// republish, defaulting to 0 for a message seen for the first time.
+func AttemptFromAttributes(attrs map[string]string) int {
+	n, err := strconv.Atoi(attrs["x-attempt"])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// DeadLetter republishes originalData to topic with the original
+// attributes plus error metadata attached, so operators can inspect why a
+// message was given up on instead of losing it to a silent ack.
+func DeadLetter(ctx context.Context, topic *pubsub.Topic, originalData []byte, attrs map[string]string, attempt int, cause error) error {
+	merged := make(map[string]string, len(attrs)+2)
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	merged["x-attempt"] = strconv.Itoa(attempt)
+	merged["x-dead-letter-reason"] = cause.Error()
+
+	res := topic.Publish(ctx, &pubsub.Message{Data: originalData, Attributes: merged})
+	if _, err := res.Get(ctx); err != nil {
+		return fmt.Errorf("retry: failed to publish to dead letter topic: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package retry
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ClassifyHTTPStatus wraps err (already describing statusCode) as
+// Permanent, RateLimited, or left as the default Retryable, based on
+// conventions shared by Firecrawl and most crawl targets: 429 is
+// RateLimited (honoring a Retry-After header if present), other 4xx
+// responses are treated as Permanent since retrying an unchanged request
+// won't fix a client error, and everything else (5xx, unrecognized codes)
+// is left Retryable.
+func ClassifyHTTPStatus(statusCode int, header http.Header, err error) error {
+	if statusCode == http.StatusTooManyRequests {
+		return AsRateLimited(err, ParseRetryAfter(header))
+	}
+	if statusCode >= 400 && statusCode < 500 {
+		return AsPermanent(err)
+	}
+	return err
+}
+
+// ParseRetryAfter reads the Retry-After header, supporting both the
+// delay-seconds and HTTP-date forms. It returns 0 if the header is absent
+// or unparseable.
+func ParseRetryAfter(header http.Header) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
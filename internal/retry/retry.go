@@ -0,0 +1,144 @@
+// Package retry provides shared error classification and capped
+// exponential backoff with jitter for the URL mapper and page processor,
+// so a handful of bad URLs can't wedge the pipeline or get retried
+// indefinitely by Pub/Sub's default redelivery.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Class categorizes why an operation failed, so Do knows whether retrying
+// has any chance of succeeding.
+type Class int
+
+const (
+	// Retryable errors may succeed on a later attempt, e.g. a transient
+	// network error or a 5xx response. This is the default for errors Do
+	// doesn't recognize as Permanent or RateLimited.
+	Retryable Class = iota
+	// Permanent errors will never succeed no matter how many times
+	// they're retried, e.g. a 404, a robots.txt disallow, or unparseable
+	// HTML.
+	Permanent
+	// RateLimited errors are retryable, but the caller has indicated how
+	// long to wait before trying again, e.g. an HTTP 429 with Retry-After.
+	RateLimited
+)
+
+// ClassifiedError attaches a Class (and, for RateLimited, a server-provided
+// delay) to an error so Do knows how to handle it.
+type ClassifiedError struct {
+	Err        error
+	Class      Class
+	RetryAfter time.Duration
+}
+
+func (e *ClassifiedError) Error() string { return e.Err.Error() }
+func (e *ClassifiedError) Unwrap() error { return e.Err }
+
+// AsPermanent wraps err so Do gives up on it immediately instead of
+// retrying.
+func AsPermanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ClassifiedError{Err: err, Class: Permanent}
+}
+
+// AsRateLimited wraps err so Do waits at least retryAfter before the next
+// attempt.
+func AsRateLimited(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &ClassifiedError{Err: err, Class: RateLimited, RetryAfter: retryAfter}
+}
+
+func classify(err error) (Class, time.Duration) {
+	var ce *ClassifiedError
+	if errors.As(err, &ce) {
+		return ce.Class, ce.RetryAfter
+	}
+	return Retryable, 0
+}
+
+// Config controls backoff timing for Do.
+type Config struct {
+	// MaxAttempts is the total number of attempts, including the first,
+	// across the handler's entire retry window for one message.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultConfig is a reasonable starting point for a Pub/Sub push handler:
+// five attempts total, starting at 500ms and capping at 30s.
+var DefaultConfig = Config{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Do calls fn, retrying with capped exponential backoff and jitter while
+// fn's error classifies as Retryable or RateLimited. startAttempt is the
+// number of attempts already spent on this message in prior invocations
+// (sourced from the message's x-attempt attribute), so the total across
+// invocations still respects cfg.MaxAttempts. fn receives the 1-indexed
+// attempt number it's being called as.
+//
+// Do returns the final error, wrapped to note attempts were exhausted,
+// once a Permanent error is returned or MaxAttempts is reached. Callers
+// whose error survives Do should dead-letter the message rather than
+// NACKing it forever.
+func Do(ctx context.Context, cfg Config, startAttempt int, fn func(ctx context.Context, attempt int) error) error {
+	attempt := startAttempt
+
+	for {
+		attempt++
+		err := fn(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+
+		class, retryAfter := classify(err)
+		if class == Permanent {
+			return err
+		}
+		if attempt >= cfg.MaxAttempts {
+			return fmt.Errorf("retry: giving up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoffDelay(cfg, attempt, class, retryAfter)):
+		}
+	}
+}
+
+// backoffDelay computes how long to wait before the next attempt. A
+// RateLimited error's RetryAfter takes precedence over the computed
+// exponential delay, since the server told us exactly how long to wait.
+func backoffDelay(cfg Config, attempt int, class Class, retryAfter time.Duration) time.Duration {
+	if class == RateLimited && retryAfter > 0 {
+		if retryAfter > cfg.MaxDelay {
+			return cfg.MaxDelay
+		}
+		return retryAfter
+	}
+
+	delay := cfg.BaseDelay * time.Duration(math.Pow(2, float64(attempt-1)))
+	if delay <= 0 || delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+
+	// Full jitter: sleep somewhere between 0 and delay, so a burst of
+	// failures on the same host doesn't retry in lockstep.
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
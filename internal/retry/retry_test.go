@@ -0,0 +1,273 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	plain := errors.New("boom")
+
+	tests := []struct {
+		name           string
+		err            error
+		wantClass      Class
+		wantRetryAfter time.Duration
+	}{
+		{"unclassified error defaults to Retryable", plain, Retryable, 0},
+		{"AsPermanent", AsPermanent(plain), Permanent, 0},
+		{"AsRateLimited", AsRateLimited(plain, 2*time.Second), RateLimited, 2 * time.Second},
+		{"wrapped classified error", fmt.Errorf("context: %w", AsPermanent(plain)), Permanent, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, retryAfter := classify(tt.err)
+			if class != tt.wantClass {
+				t.Errorf("class = %v, want %v", class, tt.wantClass)
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("retryAfter = %v, want %v", retryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAsPermanentAsRateLimitedNil(t *testing.T) {
+	if err := AsPermanent(nil); err != nil {
+		t.Errorf("AsPermanent(nil) = %v, want nil", err)
+	}
+	if err := AsRateLimited(nil, time.Second); err != nil {
+		t.Errorf("AsRateLimited(nil, ...) = %v, want nil", err)
+	}
+}
+
+func TestBackoffDelayRateLimitedUsesRetryAfter(t *testing.T) {
+	cfg := Config{BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+
+	got := backoffDelay(cfg, 1, RateLimited, 5*time.Second)
+	if got != 5*time.Second {
+		t.Errorf("backoffDelay = %v, want 5s", got)
+	}
+}
+
+func TestBackoffDelayRateLimitedCapsAtMaxDelay(t *testing.T) {
+	cfg := Config{BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+	got := backoffDelay(cfg, 1, RateLimited, time.Minute)
+	if got != cfg.MaxDelay {
+		t.Errorf("backoffDelay = %v, want %v", got, cfg.MaxDelay)
+	}
+}
+
+func TestBackoffDelayRetryableJitterBounds(t *testing.T) {
+	cfg := Config{BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		want := cfg.BaseDelay * time.Duration(1<<uint(attempt-1))
+		if want > cfg.MaxDelay {
+			want = cfg.MaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			got := backoffDelay(cfg, attempt, Retryable, 0)
+			if got < 0 || got > want {
+				t.Fatalf("attempt %d: backoffDelay = %v, want in [0, %v]", attempt, got, want)
+			}
+		}
+	}
+}
+
+func TestBackoffDelayZeroBaseDelayFallsBackToMaxDelay(t *testing.T) {
+	cfg := Config{BaseDelay: 0, MaxDelay: 10 * time.Second}
+
+	got := backoffDelay(cfg, 1, Retryable, 0)
+	if got < 0 || got > cfg.MaxDelay {
+		t.Errorf("backoffDelay = %v, want in [0, %v]", got, cfg.MaxDelay)
+	}
+}
+
+func TestDoSucceedsWithoutRetry(t *testing.T) {
+	cfg := Config{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	calls := 0
+	err := Do(context.Background(), cfg, 0, func(ctx context.Context, attempt int) error {
+		calls++
+		if attempt != 1 {
+			t.Errorf("attempt = %d, want 1", attempt)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v, want nil", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestDoStopsImmediatelyOnPermanent(t *testing.T) {
+	cfg := Config{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	permanent := AsPermanent(errors.New("not found"))
+
+	calls := 0
+	err := Do(context.Background(), cfg, 0, func(ctx context.Context, attempt int) error {
+		calls++
+		return permanent
+	})
+	if !errors.Is(err, permanent) {
+		t.Errorf("Do() = %v, want %v", err, permanent)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 (no retries for Permanent)", calls)
+	}
+}
+
+func TestDoRetriesRetryableUntilMaxAttempts(t *testing.T) {
+	cfg := Config{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	transient := errors.New("transient")
+
+	calls := 0
+	err := Do(context.Background(), cfg, 0, func(ctx context.Context, attempt int) error {
+		calls++
+		return transient
+	})
+	if err == nil {
+		t.Fatal("Do() = nil, want error after exhausting attempts")
+	}
+	if !errors.Is(err, transient) {
+		t.Errorf("Do() = %v, want wrapped %v", err, transient)
+	}
+	if calls != cfg.MaxAttempts {
+		t.Errorf("calls = %d, want %d", calls, cfg.MaxAttempts)
+	}
+}
+
+func TestDoHonorsStartAttempt(t *testing.T) {
+	cfg := Config{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	transient := errors.New("transient")
+
+	calls := 0
+	err := Do(context.Background(), cfg, 2, func(ctx context.Context, attempt int) error {
+		calls++
+		if attempt != 3 {
+			t.Errorf("attempt = %d, want 3", attempt)
+		}
+		return transient
+	})
+	if err == nil {
+		t.Fatal("Do() = nil, want error")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 (startAttempt already at MaxAttempts-1)", calls)
+	}
+}
+
+func TestDoSucceedsAfterRetries(t *testing.T) {
+	cfg := Config{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	calls := 0
+	err := Do(context.Background(), cfg, 0, func(ctx context.Context, attempt int) error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestDoReturnsContextError(t *testing.T) {
+	cfg := Config{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Do(ctx, cfg, 0, func(ctx context.Context, attempt int) error {
+		cancel()
+		return errors.New("transient")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() = %v, want context.Canceled", err)
+	}
+}
+
+func TestClassifyHTTPStatus(t *testing.T) {
+	baseErr := errors.New("request failed")
+
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		wantClass  Class
+	}{
+		{"429 without Retry-After", http.StatusTooManyRequests, http.Header{}, RateLimited},
+		{"404 is permanent", http.StatusNotFound, http.Header{}, Permanent},
+		{"400 is permanent", http.StatusBadRequest, http.Header{}, Permanent},
+		{"500 is retryable", http.StatusInternalServerError, http.Header{}, Retryable},
+		{"unrecognized status is retryable", 0, http.Header{}, Retryable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, _ := classify(ClassifyHTTPStatus(tt.statusCode, tt.header, baseErr))
+			if class != tt.wantClass {
+				t.Errorf("class = %v, want %v", class, tt.wantClass)
+			}
+		})
+	}
+}
+
+func TestClassifyHTTPStatusRateLimitedHonorsRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"30"}}
+	_, retryAfter := classify(ClassifyHTTPStatus(http.StatusTooManyRequests, header, errors.New("429")))
+	if retryAfter != 30*time.Second {
+		t.Errorf("retryAfter = %v, want 30s", retryAfter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"absent header", http.Header{}, 0},
+		{"delay-seconds form", http.Header{"Retry-After": []string{"120"}}, 120 * time.Second},
+		{"negative delay-seconds treated as 0", http.Header{"Retry-After": []string{"-5"}}, 0},
+		{"unparseable value", http.Header{"Retry-After": []string{"not-a-time"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.header); got != tt.want {
+				t.Errorf("ParseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfterHTTPDateForm(t *testing.T) {
+	future := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	header := http.Header{"Retry-After": []string{future}}
+
+	got := ParseRetryAfter(header)
+	if got <= 0 || got > 2*time.Minute+time.Second {
+		t.Errorf("ParseRetryAfter() = %v, want roughly 2m", got)
+	}
+}
+
+func TestParseRetryAfterPastHTTPDateTreatedAsZero(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	header := http.Header{"Retry-After": []string{past}}
+
+	if got := ParseRetryAfter(header); got != 0 {
+		t.Errorf("ParseRetryAfter() = %v, want 0", got)
+	}
+}
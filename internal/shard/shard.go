@@ -0,0 +1,29 @@
+// Package shard assigns crawl targets to a fixed number of shards by
+// consistent hashing on a key (typically a URL's host), so the URL mapper
+// can dispatch to per-shard topics that separate page processor
+// deployments consume with their own egress IP, proxy, or rate budget.
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// For returns the shard in [0, count) that key hashes to. count <= 0
+// always returns shard 0, so callers can treat an unsharded deployment as
+// a single implicit shard.
+func For(key string, count int) int {
+	if count <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// TopicName returns the Pub/Sub topic name for shardIdx within the series
+// prefixed by topicPrefix, e.g. TopicName("crawl-urls", 3) returns
+// "crawl-urls-shard-3".
+func TopicName(topicPrefix string, shardIdx int) string {
+	return fmt.Sprintf("%s-shard-%d", topicPrefix, shardIdx)
+}
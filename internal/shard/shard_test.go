@@ -0,0 +1,55 @@
+package shard
+
+import "testing"
+
+func TestForZeroCountReturnsShardZero(t *testing.T) {
+	if got := For("example.com", 0); got != 0 {
+		t.Errorf("For(key, 0) = %d, want 0", got)
+	}
+}
+
+func TestForNegativeCountReturnsShardZero(t *testing.T) {
+	if got := For("example.com", -3); got != 0 {
+		t.Errorf("For(key, -3) = %d, want 0", got)
+	}
+}
+
+func TestForIsStableForFixedKey(t *testing.T) {
+	const key = "example.com"
+	want := For(key, 8)
+	for i := 0; i < 20; i++ {
+		if got := For(key, 8); got != want {
+			t.Errorf("For(%q, 8) = %d on call %d, want %d (same every call)", key, got, i, want)
+		}
+	}
+}
+
+func TestForIsWithinBounds(t *testing.T) {
+	keys := []string{"a.com", "b.com", "sub.example.org", "", "192.168.0.1"}
+	for _, key := range keys {
+		for _, count := range []int{1, 2, 3, 7, 16} {
+			got := For(key, count)
+			if got < 0 || got >= count {
+				t.Errorf("For(%q, %d) = %d, want in [0, %d)", key, count, got, count)
+			}
+		}
+	}
+}
+
+func TestTopicName(t *testing.T) {
+	tests := []struct {
+		topicPrefix string
+		shardIdx    int
+		want        string
+	}{
+		{"crawl-urls", 3, "crawl-urls-shard-3"},
+		{"crawl-urls", 0, "crawl-urls-shard-0"},
+		{"pages", 12, "pages-shard-12"},
+	}
+
+	for _, tt := range tests {
+		if got := TopicName(tt.topicPrefix, tt.shardIdx); got != tt.want {
+			t.Errorf("TopicName(%q, %d) = %q, want %q", tt.topicPrefix, tt.shardIdx, got, tt.want)
+		}
+	}
+}
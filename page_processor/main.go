@@ -5,25 +5,62 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
-	md "github.com/JohannesKaufmann/html-to-markdown/v2"
-	"github.com/lib4u/fake-useragent"
+	"go.uber.org/zap"
+
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/fetch"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/observability"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/politeness"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/pubsubutil"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/retry"
+)
+
+const (
+	defaultRobotsCacheTTL  = time.Hour
+	defaultCrawlDelay      = time.Second
+	maxInlineRateLimitWait = 5 * time.Second
+
+	// defaultRenderer is used when a message doesn't set Renderer and the
+	// target domain has no RENDERER_DOMAIN_OVERRIDES entry.
+	defaultRenderer = fetch.BackendStatic
+
+	serviceName = "page_processor"
 )
 
 var (
-	projectID    string
-	topicID      string
-	crawlerID    string
-	domainToCrawl string
+	projectID         string
+	topicID           string
+	crawlerID         string
+	domainToCrawl     string
+	firecrawlAPIKey   string
+	deadLetterTopicID string
+
+	robotsChecker    *politeness.RobotsChecker
+	hostLimiter      *politeness.HostLimiter
+	rendererOverride map[string]string
+	pipelines        map[string]fetch.Pipeline
+	retryConfig      retry.Config
+
+	pubsubClient    *pubsub.Client
+	outputTopic     *pubsub.Topic
+	deadLetterTopic *pubsub.Topic
+
+	logger *zap.SugaredLogger
 )
 
 func init() {
+	logger = observability.NewLogger(serviceName)
+
 	projectID = os.Getenv("PROJECT_ID")
 	topicID = os.Getenv("OUTPUT_TOPIC_ID")
 	crawlerID = os.Getenv("CRAWLER_ID")
@@ -32,7 +69,7 @@ func init() {
 	if projectID == "" || topicID == "" {
 		log.Fatal("Missing required environment variables (PROJECT_ID, OUTPUT_TOPIC_ID)")
 	}
-	
+
 	// Set defaults for optional fields
 	if crawlerID == "" {
 		crawlerID = "unknown"
@@ -40,11 +77,113 @@ func init() {
 	if domainToCrawl == "" {
 		domainToCrawl = "unknown"
 	}
+
+	userAgent := os.Getenv("CRAWLER_USER_AGENT")
+	if userAgent == "" {
+		userAgent = politeness.DefaultUserAgent
+	}
+
+	robotsTTL := defaultRobotsCacheTTL
+	if v := os.Getenv("ROBOTS_CACHE_TTL_SECONDS"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			robotsTTL = time.Duration(secs) * time.Second
+		}
+	}
+	robotsChecker = politeness.NewRobotsChecker(userAgent, robotsTTL)
+
+	crawlDelay := defaultCrawlDelay
+	if v := os.Getenv("DEFAULT_CRAWL_DELAY_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+			crawlDelay = time.Duration(ms) * time.Millisecond
+		}
+	}
+	hostLimiter = politeness.NewHostLimiter(crawlDelay)
+
+	firecrawlAPIKey = os.Getenv("FIRECRAWL_API_KEY")
+	rendererOverride = parseRendererOverrides(os.Getenv("RENDERER_DOMAIN_OVERRIDES"))
+	deadLetterTopicID = os.Getenv("DEAD_LETTER_TOPIC_ID")
+
+	retryConfig = retry.DefaultConfig
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			retryConfig.MaxAttempts = n
+		}
+	}
+	if v := os.Getenv("RETRY_BASE_DELAY_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			retryConfig.BaseDelay = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if v := os.Getenv("RETRY_MAX_DELAY_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			retryConfig.MaxDelay = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	pipelines = map[string]fetch.Pipeline{
+		fetch.BackendStatic:   {Fetcher: fetch.NewStaticFetcher(), Converter: fetch.HTMLConverter{}},
+		fetch.BackendHeadless: {Fetcher: fetch.NewHeadlessFetcher(), Converter: fetch.HTMLConverter{}},
+	}
+	if firecrawlAPIKey != "" {
+		pipelines[fetch.BackendFirecrawl] = fetch.Pipeline{
+			Fetcher:   fetch.NewFirecrawlFetcher(firecrawlAPIKey),
+			Converter: fetch.PassthroughConverter{},
+		}
+	}
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		log.Fatalf("Failed to create pubsub client: %v", err)
+	}
+	pubsubClient = client
+
+	outputTopic = pubsubClient.Topic(topicID)
+	pubsubutil.ConfigureFromEnv(outputTopic)
+
+	if deadLetterTopicID != "" {
+		deadLetterTopic = pubsubClient.Topic(deadLetterTopicID)
+		pubsubutil.ConfigureFromEnv(deadLetterTopic)
+	}
+}
+
+// parseRendererOverrides parses a "domain=renderer,domain2=renderer2" env
+// value into a per-domain lookup table.
+func parseRendererOverrides(raw string) map[string]string {
+	overrides := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		domain, renderer, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		overrides[strings.TrimSpace(domain)] = strings.TrimSpace(renderer)
+	}
+	return overrides
+}
+
+// resolveRenderer picks the backend to use for a message: an explicit
+// per-message Renderer wins, then a per-domain override, then the default.
+func resolveRenderer(domain, messageRenderer string) string {
+	if messageRenderer != "" {
+		return messageRenderer
+	}
+	if renderer, ok := rendererOverride[domain]; ok {
+		return renderer
+	}
+	return defaultRenderer
 }
 
 // PubSubMessage is the payload of a Pub/Sub event.
 type PubSubMessage struct {
 	Data []byte `json:"data"`
+
+	// Attributes carries message attributes, including "x-attempt" set by
+	// a prior dead-letter republish so retry counts survive redelivery.
+	Attributes map[string]string `json:"attributes"`
 }
 
 // PushRequest represents the request body from Pub/Sub push subscription
@@ -57,6 +196,11 @@ type InputMessage struct {
 	URL    string `json:"url"`
 	UID    string `json:"uid"`
 	Domain string `json:"domain"`
+
+	// Renderer optionally selects the fetch backend for this URL: "static",
+	// "headless", or "firecrawl". Empty defers to RENDERER_DOMAIN_OVERRIDES
+	// then defaultRenderer.
+	Renderer string `json:"renderer"`
 }
 
 // OutputMessage is the message that will be published to the output topic.
@@ -72,14 +216,20 @@ type OutputMessage struct {
 
 // ProcessPubSubPush is the entry point for the Cloud Function.
 func ProcessPubSubPush(ctx context.Context, m PubSubMessage) error {
+	observability.MessagesReceived.WithLabelValues(serviceName).Inc()
+
+	ctx = observability.ExtractTraceparent(ctx, m.Attributes)
+	ctx, span := observability.Tracer.Start(ctx, "page_processor.process")
+	defer span.End()
+
 	var d InputMessage
 	if err := json.Unmarshal(m.Data, &d); err != nil {
-		log.Printf("failed to unmarshal message data: %v", err)
+		logger.Errorw("failed to unmarshal message data", "error", err)
 		return nil // Acknowledge and don't retry malformed messages
 	}
 
 	if d.URL == "" {
-		log.Printf("URL is empty in message")
+		logger.Infow("URL is empty in message")
 		return nil // Acknowledge and don't retry empty messages
 	}
 
@@ -95,12 +245,35 @@ func ProcessPubSubPush(ctx context.Context, m PubSubMessage) error {
 		uid = "unknown"
 	}
 
-	markdown, err := convertURLToMarkdown(d.URL)
+	reqLog := logger.With("uid", uid, "domain", domain, "url", d.URL, "crawler_id", crawlerID)
+
+	renderer := resolveRenderer(domain, d.Renderer)
+	startAttempt := retry.AttemptFromAttributes(m.Attributes)
+
+	var markdown string
 	status := "success"
-	if err != nil {
-		log.Printf("Failed to convert URL to markdown for %s: %v", d.URL, err)
+	convertErr := retry.Do(ctx, retryConfig, startAttempt, func(ctx context.Context, attempt int) error {
+		md, err := convertURLToMarkdown(ctx, d.URL, renderer)
+		if err != nil {
+			return err
+		}
+		markdown = md
+		return nil
+	})
+	if convertErr != nil {
+		reqLog.Errorw("failed to convert URL to markdown", "error", convertErr)
+		if deadLetterTopicID != "" {
+			if dlErr := retry.DeadLetter(ctx, deadLetterTopic, m.Data, m.Attributes, startAttempt, convertErr); dlErr != nil {
+				reqLog.Errorw("failed to dead-letter message", "error", dlErr)
+				observability.MessagesNacked.WithLabelValues(serviceName).Inc()
+				return dlErr
+			}
+			observability.MessagesDeadLettered.WithLabelValues(serviceName).Inc()
+			reqLog.Warnw("dead-lettered after exhausting retries", "error", convertErr)
+			return nil
+		}
 		status = "error"
-		markdown = err.Error()
+		markdown = convertErr.Error()
 	}
 
 	output := OutputMessage{
@@ -115,70 +288,100 @@ func ProcessPubSubPush(ctx context.Context, m PubSubMessage) error {
 
 	outputData, err := json.Marshal(output)
 	if err != nil {
-		log.Printf("Failed to marshal output message for %s: %v", d.URL, err)
+		reqLog.Errorw("failed to marshal output message", "error", err)
 		return err // Return error to retry
 	}
 
-	client, err := pubsub.NewClient(ctx, projectID)
-	if err != nil {
-		log.Printf("Failed to create pubsub client: %v", err)
+	publishErr := retry.Do(ctx, retryConfig, 0, func(ctx context.Context, attempt int) error {
+		attrs := observability.InjectTraceparent(ctx, nil)
+		start := time.Now()
+		res := outputTopic.Publish(ctx, &pubsub.Message{Data: outputData, Attributes: attrs})
+		_, err := res.Get(ctx)
+		observability.PublishDuration.WithLabelValues(topicID).Observe(time.Since(start).Seconds())
 		return err
-	}
-	defer client.Close()
-
-	topic := client.Topic(topicID)
-	res := topic.Publish(ctx, &pubsub.Message{
-		Data: outputData,
 	})
-
-	if _, err := res.Get(ctx); err != nil {
-		log.Printf("Failed to publish message for %s: %v", d.URL, err)
-		return err
+	if publishErr != nil {
+		reqLog.Errorw("failed to publish message", "error", publishErr)
+		if deadLetterTopicID != "" {
+			if dlErr := retry.DeadLetter(ctx, deadLetterTopic, m.Data, m.Attributes, startAttempt, publishErr); dlErr != nil {
+				reqLog.Errorw("failed to dead-letter message", "error", dlErr)
+				observability.MessagesNacked.WithLabelValues(serviceName).Inc()
+				return dlErr
+			}
+			observability.MessagesDeadLettered.WithLabelValues(serviceName).Inc()
+			reqLog.Warnw("dead-lettered after publish failures", "error", publishErr)
+			return nil
+		}
+		observability.MessagesNacked.WithLabelValues(serviceName).Inc()
+		return publishErr
 	}
 
-	log.Printf("Successfully processed and published data for URL: %s (status: %s)", d.URL, status)
+	observability.MessagesAcked.WithLabelValues(serviceName).Inc()
+	reqLog.Infow("successfully processed and published data", "status", status)
 	return nil
 }
 
-func convertURLToMarkdown(url string) (string, error) {
-	httpClient := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+// convertURLToMarkdown fetches rawURL via the given renderer backend and
+// converts it to Markdown, honoring the host's robots.txt and per-host
+// crawl rate.
+func convertURLToMarkdown(ctx context.Context, rawURL, renderer string) (string, error) {
+	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return "", retry.AsPermanent(fmt.Errorf("failed to parse URL: %v", err))
 	}
 
-	// Using a fake user-agent to avoid being blocked by some websites.
-	ua, err := fakeUserAgent.New()
+	allowed, err := robotsChecker.Allowed(ctx, rawURL)
 	if err != nil {
-		// Fallback to a generic user-agent if the library fails
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36")
-	} else {
-		req.Header.Set("User-Agent", ua.GetRandom())
+		return "", fmt.Errorf("failed to check robots.txt for %s: %w", rawURL, err)
+	}
+	if !allowed {
+		return "", retry.AsPermanent(fmt.Errorf("url disallowed by robots.txt: %s", rawURL))
 	}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to download URL: %v", err)
+	if delay, ok := robotsChecker.CrawlDelay(ctx, rawURL); ok {
+		hostLimiter.SetInterval(parsedURL.Host, delay)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download URL: status code %d", resp.StatusCode)
+	if err := waitForRateLimit(ctx, parsedURL.Host); err != nil {
+		return "", err
 	}
 
-	html, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
+	pipeline, ok := pipelines[renderer]
+	if !ok {
+		logger.Warnw("unknown renderer, falling back to default", "renderer", renderer, "url", rawURL, "default_renderer", defaultRenderer)
+		pipeline = pipelines[defaultRenderer]
 	}
 
-	markdown, err := md.ConvertString(string(html))
+	markdown, err := pipeline.Run(ctx, rawURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert HTML to Markdown: %v", err)
+		return "", fmt.Errorf("failed to fetch and convert URL: %w", err)
 	}
 
 	return markdown, nil
 }
 
+// waitForRateLimit blocks until host's crawl-delay token bucket has a slot
+// free. If the wait would be longer than maxInlineRateLimitWait, it returns
+// an error instead so the caller can requeue the message rather than
+// holding the request open.
+func waitForRateLimit(ctx context.Context, host string) error {
+	for {
+		ok, retryAfter := hostLimiter.Reserve(host)
+		if ok {
+			return nil
+		}
+		if retryAfter > maxInlineRateLimitWait {
+			err := fmt.Errorf("rate limit exceeded for host %s, retry after %s", host, retryAfter)
+			return retry.AsRateLimited(err, retryAfter)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
 // httpHandler wraps the Cloud Function logic for Cloud Run
 func httpHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -188,7 +391,7 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 
 	var pushReq PushRequest
 	if err := json.NewDecoder(r.Body).Decode(&pushReq); err != nil {
-		log.Printf("Failed to decode push request: %v", err)
+		logger.Errorw("failed to decode push request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -206,11 +409,11 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	message := PubSubMessage{Data: data}
+	message := PubSubMessage{Data: data, Attributes: pushReq.Message.Attributes}
 	ctx := r.Context()
 
 	if err := ProcessPubSubPush(ctx, message); err != nil {
-		log.Printf("Error processing message: %v", err)
+		logger.Errorw("error processing message", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -220,9 +423,31 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	http.HandleFunc("/", httpHandler)
-	log.Println("Page Processor server starting on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
+	defer pubsubClient.Close()
+	defer outputTopic.Stop()
+	if deadLetterTopic != nil {
+		defer deadLetterTopic.Stop()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", httpHandler)
+	mux.Handle("/metrics", observability.Handler())
+
+	server := &http.Server{Addr: ":8080", Handler: mux}
+
+	go func() {
+		logger.Infow("Page Processor server starting", "port", 8080)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatalw("server error", "error", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	logger.Info("shutting down")
+	if err := server.Shutdown(context.Background()); err != nil {
+		logger.Errorw("error shutting down server", "error", err)
 	}
 }
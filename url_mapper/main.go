@@ -11,16 +11,34 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"go.uber.org/zap"
+
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/observability"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/politeness"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/pubsubutil"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/retry"
+	"github.com/vantige-ai/naive-crawler-datamesh/internal/shard"
 )
 
+const serviceName = "url_mapper"
+
 // PubSubMessage is the payload of a Pub/Sub event.
 type PubSubMessage struct {
 	Data []byte `json:"data"`
+
+	// Attributes carries message attributes, including "x-attempt" set by
+	// a prior dead-letter republish so retry counts survive redelivery.
+	Attributes map[string]string `json:"attributes"`
 }
 
 // PushRequest represents the request body from Pub/Sub push subscription
@@ -39,6 +57,11 @@ type URLMessage struct {
 	URL    string `json:"url"`
 	UID    string `json:"uid"`
 	Domain string `json:"domain"`
+
+	// Shard is the consistent-hash shard (on the URL's host) the message
+	// was dispatched to. 0 in single-topic mode, where it carries no
+	// dispatch meaning.
+	Shard int `json:"shard"`
 }
 
 // firecrawlRequest is the request sent to the Firecrawl API.
@@ -52,14 +75,35 @@ type firecrawlResponse struct {
 	Links []string `json:"links"`
 }
 
+const defaultRobotsCacheTTL = time.Hour
+
 var (
-	projectID       string
-	topicID         string
-	firecrawlAPIKey string
-	firecrawlAPIURL = "https://api.firecrawl.dev/v1/map"
+	projectID         string
+	topicID           string
+	firecrawlAPIKey   string
+	firecrawlAPIURL   = "https://api.firecrawl.dev/v1/map"
+	deadLetterTopicID string
+
+	robotsChecker *politeness.RobotsChecker
+	sitemapClient = &http.Client{Timeout: 10 * time.Second}
+	retryConfig   retry.Config
+
+	pubsubClient    *pubsub.Client
+	outputTopic     *pubsub.Topic
+	deadLetterTopic *pubsub.Topic
+
+	// shardCount is the number of per-shard topics to dispatch across, 0
+	// meaning single-topic mode (publish everything to outputTopic).
+	shardCount    int
+	shardTopics   []*pubsub.Topic
+	shardTopicIDs []string
+
+	logger *zap.SugaredLogger
 )
 
 func init() {
+	logger = observability.NewLogger(serviceName)
+
 	projectID = os.Getenv("PROJECT_ID")
 	topicID = os.Getenv("URL_TOPIC_ID")
 	firecrawlAPIKey = os.Getenv("FIRECRAWL_API_KEY")
@@ -67,6 +111,71 @@ func init() {
 	if projectID == "" || topicID == "" || firecrawlAPIKey == "" {
 		log.Fatal("Missing required environment variables (PROJECT_ID, URL_TOPIC_ID, FIRECRAWL_API_KEY)")
 	}
+
+	userAgent := os.Getenv("CRAWLER_USER_AGENT")
+	if userAgent == "" {
+		userAgent = politeness.DefaultUserAgent
+	}
+
+	robotsTTL := defaultRobotsCacheTTL
+	if v := os.Getenv("ROBOTS_CACHE_TTL_SECONDS"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			robotsTTL = time.Duration(secs) * time.Second
+		}
+	}
+
+	robotsChecker = politeness.NewRobotsChecker(userAgent, robotsTTL)
+
+	deadLetterTopicID = os.Getenv("DEAD_LETTER_TOPIC_ID")
+
+	retryConfig = retry.DefaultConfig
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			retryConfig.MaxAttempts = n
+		}
+	}
+	if v := os.Getenv("RETRY_BASE_DELAY_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			retryConfig.BaseDelay = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if v := os.Getenv("RETRY_MAX_DELAY_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			retryConfig.MaxDelay = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		log.Fatalf("Failed to create pubsub client: %v", err)
+	}
+	pubsubClient = client
+
+	outputTopic = pubsubClient.Topic(topicID)
+	pubsubutil.ConfigureFromEnv(outputTopic)
+
+	if deadLetterTopicID != "" {
+		deadLetterTopic = pubsubClient.Topic(deadLetterTopicID)
+		pubsubutil.ConfigureFromEnv(deadLetterTopic)
+	}
+
+	if v := os.Getenv("SHARD_COUNT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			shardCount = n
+		}
+	}
+	if shardCount > 0 {
+		shardTopics = make([]*pubsub.Topic, shardCount)
+		shardTopicIDs = make([]string, shardCount)
+		for i := 0; i < shardCount; i++ {
+			id := shard.TopicName(topicID, i)
+			shardTopicIDs[i] = id
+			t := pubsubClient.Topic(id)
+			pubsubutil.ConfigureFromEnv(t)
+			shardTopics[i] = t
+		}
+	}
 }
 
 // generateUID creates a unique identifier if one wasn't provided
@@ -75,7 +184,7 @@ func generateUID() string {
 	bytes := make([]byte, 4)
 	rand.Read(bytes)
 	randomHex := hex.EncodeToString(bytes)
-	
+
 	// Format: auto-{unix-timestamp}-{random-hex}
 	return fmt.Sprintf("auto-%d-%s", time.Now().Unix(), randomHex)
 }
@@ -83,92 +192,206 @@ func generateUID() string {
 // ProcessPubSubPush is the entry point for the Cloud Function.
 // It's triggered by a message on a Pub/Sub topic.
 func ProcessPubSubPush(ctx context.Context, m PubSubMessage) error {
+	observability.MessagesReceived.WithLabelValues(serviceName).Inc()
+
+	ctx = observability.ExtractTraceparent(ctx, m.Attributes)
+	ctx, span := observability.Tracer.Start(ctx, "url_mapper.process")
+	defer span.End()
+
 	var d InputMessage
 	if err := json.Unmarshal(m.Data, &d); err != nil {
-		log.Printf("failed to unmarshal message data: %v", err)
+		logger.Errorw("failed to unmarshal message data", "error", err)
 		// Return nil to acknowledge the message and prevent retries for malformed data.
 		return nil
 	}
 
 	if d.Domain == "" {
-		log.Printf("Domain is empty in message, acknowledging to avoid retry.")
+		logger.Infow("domain is empty in message, acknowledging to avoid retry")
 		return nil
 	}
 
 	// Generate UID if not provided
 	if d.UID == "" {
 		d.UID = generateUID()
-		log.Printf("Generated UID for domain %s: %s", d.Domain, d.UID)
+		logger.Infow("generated UID for domain", "domain", d.Domain, "uid", d.UID)
 	}
 
-	log.Printf("Received crawl request for domain: %s, UID: %s", d.Domain, d.UID)
+	reqLog := logger.With("domain", d.Domain, "uid", d.UID)
+	reqLog.Infow("received crawl request")
 
-	apiResponse, err := callFirecrawlAPI(ctx, firecrawlAPIKey, d.Domain, true)
-	if err != nil {
-		log.Printf("Error calling Firecrawl API for domain %s (UID: %s): %v", d.Domain, d.UID, err)
-		// Return the error to signal that the function failed and should be retried.
-		return err
-	}
+	startAttempt := retry.AttemptFromAttributes(m.Attributes)
 
-	if err := publishLinks(ctx, apiResponse.Links, d.UID, d.Domain); err != nil {
-		log.Printf("Error publishing links for domain %s (UID: %s): %v", d.Domain, d.UID, err)
-		return err
+	var links []string
+	pipelineErr := retry.Do(ctx, retryConfig, startAttempt, func(ctx context.Context, attempt int) error {
+		apiResponse, err := callFirecrawlAPI(ctx, firecrawlAPIKey, d.Domain, true)
+		if err != nil {
+			return err
+		}
+		links = mergeSitemapLinks(ctx, d.Domain, apiResponse.Links)
+		return publishLinks(ctx, links, d.UID, d.Domain)
+	})
+	if pipelineErr != nil {
+		reqLog.Errorw("error processing domain", "error", pipelineErr)
+		if deadLetterTopicID != "" {
+			if dlErr := retry.DeadLetter(ctx, deadLetterTopic, m.Data, m.Attributes, startAttempt, pipelineErr); dlErr != nil {
+				reqLog.Errorw("failed to dead-letter message", "error", dlErr)
+				observability.MessagesNacked.WithLabelValues(serviceName).Inc()
+				return dlErr
+			}
+			observability.MessagesDeadLettered.WithLabelValues(serviceName).Inc()
+			reqLog.Warnw("dead-lettered domain after exhausting retries", "error", pipelineErr)
+			return nil
+		}
+		observability.MessagesNacked.WithLabelValues(serviceName).Inc()
+		return pipelineErr
 	}
 
-	log.Printf("Successfully published %d URLs for domain %s (UID: %s) to topic %s", len(apiResponse.Links), d.Domain, d.UID, topicID)
+	observability.MessagesAcked.WithLabelValues(serviceName).Inc()
+	reqLog.Infow("successfully published URLs", "count", len(links), "topic", topicID)
 	return nil
 }
 
-// publishLinks publishes a list of URLs to the Pub/Sub topic.
-func publishLinks(ctx context.Context, links []string, uid string, domain string) error {
-	client, err := pubsub.NewClient(ctx, projectID)
+// mergeSitemapLinks augments firecrawlLinks with any page URLs discovered
+// via Sitemap: entries in domain's robots.txt, deduplicating the result.
+func mergeSitemapLinks(ctx context.Context, domain string, firecrawlLinks []string) []string {
+	seen := make(map[string]bool, len(firecrawlLinks))
+	merged := make([]string, 0, len(firecrawlLinks))
+	for _, l := range firecrawlLinks {
+		if !seen[l] {
+			seen[l] = true
+			merged = append(merged, l)
+		}
+	}
+
+	sitemaps, err := robotsChecker.Sitemaps(ctx, normalizeDomainURL(domain))
 	if err != nil {
-		return fmt.Errorf("failed to create pubsub client: %w", err)
+		logger.Warnw("failed to fetch robots.txt sitemaps", "domain", domain, "error", err)
+		return merged
+	}
+	if len(sitemaps) == 0 {
+		return merged
+	}
+
+	for _, sitemapURL := range sitemaps {
+		urls, err := politeness.FetchSitemapURLs(ctx, sitemapClient, sitemapURL)
+		if err != nil {
+			logger.Warnw("failed to fetch sitemap", "sitemap_url", sitemapURL, "domain", domain, "error", err)
+			continue
+		}
+		for _, u := range urls {
+			if !seen[u] {
+				seen[u] = true
+				merged = append(merged, u)
+			}
+		}
 	}
-	defer client.Close()
 
-	topic := client.Topic(topicID)
-	defer topic.Stop()
+	return merged
+}
 
-	var wg sync.WaitGroup
-	var errs []error
-	var mu sync.Mutex
+// shardBatch accumulates the PublishResults bound for a single topic, so
+// publishLinks can drain each shard's publishes with its own topic label.
+type shardBatch struct {
+	topic     *pubsub.Topic
+	topicName string
+	results   []*pubsub.PublishResult
+}
+
+// publishLinks publishes a list of URLs, filtering out any the target
+// host's robots.txt disallows. In single-topic mode (shardCount == 0)
+// every link goes to outputTopic with Shard 0. Otherwise each link is
+// dispatched by consistent hashing on its host to one of shardCount
+// per-shard topics, so operators can run one page processor deployment
+// per shard. Publish calls are submitted without spawning a goroutine per
+// link, letting the client's own batching (see pubsubutil.ConfigureFromEnv)
+// coalesce them into fewer RPCs; the resulting PublishResults are then
+// drained per topic by a bounded worker pool.
+func publishLinks(ctx context.Context, links []string, uid string, domain string) error {
+	batches := make(map[int]*shardBatch)
 
 	for _, link := range links {
-		wg.Add(1)
-		go func(l string) {
-			defer wg.Done()
-			msgData, err := json.Marshal(URLMessage{
-				URL:    l,
-				UID:    uid,
-				Domain: domain,
-			})
-			if err != nil {
-				mu.Lock()
-				errs = append(errs, fmt.Errorf("failed to marshal message for %s: %w", l, err))
-				mu.Unlock()
-				return
-			}
+		allowed, err := robotsChecker.Allowed(ctx, link)
+		if err != nil {
+			logger.Warnw("failed to check robots.txt, skipping", "url", link, "error", err)
+			continue
+		}
+		if !allowed {
+			logger.Infow("skipping url disallowed by robots.txt", "url", link)
+			continue
+		}
 
-			res := topic.Publish(ctx, &pubsub.Message{Data: msgData})
-			if _, err := res.Get(ctx); err != nil {
-				mu.Lock()
-				errs = append(errs, fmt.Errorf("failed to publish message for %s: %w", l, err))
-				mu.Unlock()
-				log.Printf("Failed to publish message for %s: %v", l, err)
-			}
-		}(link)
+		shardIdx := 0
+		topic, topicName := outputTopic, topicID
+		if shardCount > 0 {
+			shardIdx = shard.For(hostOf(link), shardCount)
+			topic, topicName = shardTopics[shardIdx], shardTopicIDs[shardIdx]
+		}
+
+		msgData, err := json.Marshal(URLMessage{
+			URL:    link,
+			UID:    uid,
+			Domain: domain,
+			Shard:  shardIdx,
+		})
+		if err != nil {
+			logger.Warnw("failed to marshal message, skipping", "url", link, "error", err)
+			continue
+		}
+
+		b, ok := batches[shardIdx]
+		if !ok {
+			b = &shardBatch{topic: topic, topicName: topicName}
+			batches[shardIdx] = b
+		}
+
+		attrs := observability.InjectTraceparent(ctx, nil)
+		b.results = append(b.results, b.topic.Publish(ctx, &pubsub.Message{Data: msgData, Attributes: attrs}))
 	}
 
+	var wg sync.WaitGroup
+	errs := make([]error, len(batches))
+	i := 0
+	for _, b := range batches {
+		wg.Add(1)
+		go func(i int, b *shardBatch) {
+			defer wg.Done()
+			errs[i] = pubsubutil.Drain(ctx, b.results, pubsubutil.DrainWorkers(), b.topicName)
+		}(i, b)
+		i++
+	}
 	wg.Wait()
 
-	if len(errs) > 0 {
-		return fmt.Errorf("encountered %d errors while publishing. First error: %w", len(errs), errs[0])
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to publish links: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// normalizeDomainURL turns a bare crawl target like "example.com" into a
+// URL robotsChecker can fetch robots.txt from. InputMessage.Domain and the
+// Firecrawl request both take a bare domain, but RobotsChecker needs a
+// scheme to build the robots.txt request.
+func normalizeDomainURL(domain string) string {
+	if strings.Contains(domain, "://") {
+		return domain
+	}
+	return "https://" + domain
+}
+
+// hostOf returns rawURL's host for shard assignment, or rawURL itself if
+// it doesn't parse, so a malformed URL still hashes deterministically
+// instead of always landing on shard 0.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
+
 // callFirecrawlAPI encapsulates the logic for calling the external API.
 func callFirecrawlAPI(ctx context.Context, apiKey, url string, includeSubdomains bool) (*firecrawlResponse, error) {
 	reqBody := firecrawlRequest{
@@ -190,15 +413,19 @@ func callFirecrawlAPI(ctx context.Context, apiKey, url string, includeSubdomains
 	firecrawlReq.Header.Set("Content-Type", "application/json")
 	firecrawlReq.Header.Set("Authorization", "Bearer "+apiKey)
 
+	start := time.Now()
 	resp, err := client.Do(firecrawlReq)
 	if err != nil {
+		observability.FirecrawlRequestDuration.WithLabelValues("map", "error").Observe(time.Since(start).Seconds())
 		return nil, fmt.Errorf("failed to call Firecrawl API: %w", err)
 	}
 	defer resp.Body.Close()
+	observability.FirecrawlRequestDuration.WithLabelValues("map", strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("firecrawl API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		err := fmt.Errorf("firecrawl API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, retry.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)
 	}
 
 	var apiResp firecrawlResponse
@@ -218,7 +445,7 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 
 	var pushReq PushRequest
 	if err := json.NewDecoder(r.Body).Decode(&pushReq); err != nil {
-		log.Printf("Failed to decode push request: %v", err)
+		logger.Errorw("failed to decode push request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -236,11 +463,11 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	message := PubSubMessage{Data: data}
+	message := PubSubMessage{Data: data, Attributes: pushReq.Message.Attributes}
 	ctx := r.Context()
 
 	if err := ProcessPubSubPush(ctx, message); err != nil {
-		log.Printf("Error processing message: %v", err)
+		logger.Errorw("error processing message", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -250,9 +477,34 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	http.HandleFunc("/", httpHandler)
-	log.Println("URL Mapper server starting on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
+	defer pubsubClient.Close()
+	defer outputTopic.Stop()
+	if deadLetterTopic != nil {
+		defer deadLetterTopic.Stop()
+	}
+	for _, t := range shardTopics {
+		defer t.Stop()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", httpHandler)
+	mux.Handle("/metrics", observability.Handler())
+
+	server := &http.Server{Addr: ":8080", Handler: mux}
+
+	go func() {
+		logger.Infow("URL Mapper server starting", "port", 8080)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatalw("server error", "error", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	logger.Info("shutting down")
+	if err := server.Shutdown(context.Background()); err != nil {
+		logger.Errorw("error shutting down server", "error", err)
 	}
 }